@@ -0,0 +1,109 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc/internal/metadata"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+const (
+	defaultMinRingSize = 1024
+	defaultMaxRingSize = 8388608 // 8M
+
+	// maxRingSize is the upper bound on min_ring_size and max_ring_size, to
+	// keep the ring construction cost and memory bounded.
+	maxRingSize = 8 * 1024 * 1024
+
+	// defaultHashFunction is used whenever LBConfig.HashFunction is unset.
+	// It's the only hash function this implementation supported before
+	// HashFunction was added, so it remains the default for backward
+	// compatibility.
+	defaultHashFunction = hashFunctionXXHash
+
+	hashFunctionXXHash = "XX_HASH"
+	hashFunctionMurmur = "MURMUR_HASH_2"
+	hashFunctionCRC32  = "CRC32"
+)
+
+// LBConfig is the balancer config for ring_hash balancer.
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	MinRingSize uint64 `json:"minRingSize,omitempty"`
+	MaxRingSize uint64 `json:"maxRingSize,omitempty"`
+
+	// RequestMetadataKey, if set, is the name of a gRPC metadata header
+	// whose value(s) are used to compute the request hash for a pick,
+	// instead of relying on the hash set on the RPC context by the CDS
+	// balancer (via SetRequestHash). This allows ring_hash to be used
+	// without an xDS control plane, e.g. behind a plain DNS resolver with
+	// a static service config.
+	RequestMetadataKey string `json:"request_metadata_key,omitempty"`
+
+	// HashFunction determines both how endpoints are placed on the ring and
+	// how request hashes are computed from a RequestMetadataKey header
+	// value. It must be one of "XX_HASH" (the default), "MURMUR_HASH_2", or
+	// "CRC32"; the non-default values exist for interoperability with other
+	// proxies configured to hash the same way.
+	HashFunction string `json:"hashFunction,omitempty"`
+}
+
+func (bb) ParseConfig(c json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	return parseConfig(c)
+}
+
+func parseConfig(c json.RawMessage) (*LBConfig, error) {
+	var cfg LBConfig
+	if err := json.Unmarshal(c, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.MinRingSize == 0 {
+		cfg.MinRingSize = defaultMinRingSize
+	}
+	if cfg.MaxRingSize == 0 {
+		cfg.MaxRingSize = defaultMaxRingSize
+	}
+	if cfg.HashFunction == "" {
+		cfg.HashFunction = defaultHashFunction
+	}
+	if cfg.MinRingSize > maxRingSize {
+		return nil, fmt.Errorf("min_ring_size value of %d is greater than max supported value %d", cfg.MinRingSize, maxRingSize)
+	}
+	if cfg.MaxRingSize > maxRingSize {
+		return nil, fmt.Errorf("max_ring_size value of %d is greater than max supported value %d", cfg.MaxRingSize, maxRingSize)
+	}
+	if cfg.MinRingSize > cfg.MaxRingSize {
+		return nil, fmt.Errorf("min %v is greater than max %v", cfg.MinRingSize, cfg.MaxRingSize)
+	}
+	if cfg.RequestMetadataKey != "" {
+		if err := metadata.ValidatePair(cfg.RequestMetadataKey, ""); err != nil {
+			return nil, fmt.Errorf("invalid request_metadata_key %q: %v", cfg.RequestMetadataKey, err)
+		}
+	}
+	switch cfg.HashFunction {
+	case hashFunctionXXHash, hashFunctionMurmur, hashFunctionCRC32:
+	default:
+		return nil, fmt.Errorf("unsupported hashFunction %q", cfg.HashFunction)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,70 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import "testing"
+
+func (s) TestParseConfig_HashFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		js       string
+		wantFunc string
+		wantErr  bool
+	}{
+		{
+			name:     "unset defaults to XX_HASH",
+			js:       `{}`,
+			wantFunc: hashFunctionXXHash,
+		},
+		{
+			name:     "xx_hash",
+			js:       `{"hashFunction": "XX_HASH"}`,
+			wantFunc: hashFunctionXXHash,
+		},
+		{
+			name:     "murmur",
+			js:       `{"hashFunction": "MURMUR_HASH_2"}`,
+			wantFunc: hashFunctionMurmur,
+		},
+		{
+			name:     "crc32",
+			js:       `{"hashFunction": "CRC32"}`,
+			wantFunc: hashFunctionCRC32,
+		},
+		{
+			name:    "unsupported",
+			js:      `{"hashFunction": "SHA256"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig([]byte(tt.js))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConfig(%s) returned err %v, wantErr %v", tt.js, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.HashFunction != tt.wantFunc {
+				t.Fatalf("parseConfig(%s).HashFunction = %q, want %q", tt.js, cfg.HashFunction, tt.wantFunc)
+			}
+		})
+	}
+}
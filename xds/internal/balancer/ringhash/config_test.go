@@ -0,0 +1,60 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import "testing"
+
+func (s) TestParseConfig_RequestMetadataKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		js      string
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name:    "unset",
+			js:      `{}`,
+			wantKey: "",
+		},
+		{
+			name:    "valid",
+			js:      `{"request_metadata_key": "x-user-id"}`,
+			wantKey: "x-user-id",
+		},
+		{
+			name:    "invalid header name",
+			js:      `{"request_metadata_key": "not a valid header!"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig([]byte(tt.js))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConfig(%s) returned err %v, wantErr %v", tt.js, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.RequestMetadataKey != tt.wantKey {
+				t.Fatalf("parseConfig(%s).RequestMetadataKey = %q, want %q", tt.js, cfg.RequestMetadataKey, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"github.com/cespare/xxhash/v2"
+	ringhashinternal "google.golang.org/grpc/xds/internal/balancer/ringhash/internal/hash"
+)
+
+// hashString hashes s using the hash function named by fn (one of the
+// hashFunctionXXHash/hashFunctionMurmur/hashFunctionCRC32 constants, as
+// validated by parseConfig). It's used both to place endpoints on the ring
+// and to hash a RequestMetadataKey header value for a pick, so the two stay
+// consistent with whichever hash function the config selects.
+func hashString(fn, s string) uint64 {
+	switch fn {
+	case hashFunctionMurmur:
+		return ringhashinternal.MurmurHash2_64A([]byte(s), 0)
+	case hashFunctionCRC32:
+		return ringhashinternal.CRC32([]byte(s))
+	default:
+		return xxhash.Sum64String(s)
+	}
+}
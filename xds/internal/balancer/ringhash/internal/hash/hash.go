@@ -0,0 +1,71 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package hash implements the non-default hash functions that the
+// ring_hash LB policy can be configured to use, for interoperability with
+// other proxies (e.g. Envoy) that were configured to use the same one.
+package hash
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CRC32 returns the CRC-32C (Castagnoli) checksum of data.
+func CRC32(data []byte) uint64 {
+	return uint64(crc32.Checksum(data, crc32cTable))
+}
+
+// MurmurHash2_64A returns the 64-bit variant A of Austin Appleby's
+// MurmurHash2 of data, seeded with seed.
+func MurmurHash2_64A(data []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+
+	h := seed ^ (uint64(len(data)) * m)
+
+	nblocks := len(data) / 8
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint64(data[i*8:])
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+	}
+
+	if tail := data[nblocks*8:]; len(tail) > 0 {
+		var k uint64
+		for i := len(tail) - 1; i >= 0; i-- {
+			k = k<<8 | uint64(tail[i])
+		}
+		h ^= k
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+
+	return h
+}
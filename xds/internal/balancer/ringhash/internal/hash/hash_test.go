@@ -0,0 +1,49 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package hash
+
+import "testing"
+
+func TestCRC32(t *testing.T) {
+	// "123456789" is the standard check value for CRC-32C (Castagnoli).
+	if got, want := CRC32([]byte("123456789")), uint64(0xe3069283); got != want {
+		t.Errorf("CRC32(%q) = %#x, want %#x", "123456789", got, want)
+	}
+	if got, want := CRC32(nil), uint64(0); got != want {
+		t.Errorf("CRC32(nil) = %#x, want %#x", got, want)
+	}
+}
+
+func TestMurmurHash2_64A(t *testing.T) {
+	tests := []struct {
+		data string
+		seed uint64
+		want uint64
+	}{
+		{data: "", seed: 0, want: 0},
+		{data: "grpc", seed: 0, want: 14749661411280833267},
+		{data: "ring_hash", seed: 0, want: 13507404466054592470},
+		{data: "hello world", seed: 104729, want: 6393391156947769318},
+	}
+	for _, tt := range tests {
+		if got := MurmurHash2_64A([]byte(tt.data), tt.seed); got != tt.want {
+			t.Errorf("MurmurHash2_64A(%q, %d) = %d, want %d", tt.data, tt.seed, got, tt.want)
+		}
+	}
+}
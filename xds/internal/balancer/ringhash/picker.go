@@ -0,0 +1,209 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/grpcrand"
+	"google.golang.org/grpc/metadata"
+)
+
+type requestHashKeyType struct{}
+
+// SetRequestHash returns a new context with the given request hash added to
+// it. The ring_hash LB policy will pick the subConn based on the hash, when
+// the picker is configured to read the hash from the context (i.e. when
+// LBConfig.RequestMetadataKey isn't set). It's usually set by the CDS
+// balancer after computing the hash from xDS hash_policy configuration.
+func SetRequestHash(ctx context.Context, hash uint64) context.Context {
+	return context.WithValue(ctx, requestHashKeyType{}, hash)
+}
+
+// getRequestHash returns the hash set on ctx by SetRequestHash, and whether
+// one was set at all: a CDS-driven pick always has one, but a pick made
+// without an xDS control plane in the picture never does, and the two cases
+// must be told apart rather than both defaulting to a hash of 0.
+func getRequestHash(ctx context.Context) (uint64, bool) {
+	v := ctx.Value(requestHashKeyType{})
+	if v == nil {
+		return 0, false
+	}
+	return v.(uint64), true
+}
+
+// GetRequestHashForTesting returns the request hash stored in the context set
+// by SetRequestHash, or 0 if none was set. It's exported for use in tests
+// only.
+func GetRequestHashForTesting(ctx context.Context) uint64 {
+	h, _ := getRequestHash(ctx)
+	return h
+}
+
+type picker struct {
+	ring               *ring
+	requestMetadataKey string
+	hashFunction       string
+
+	// scStates is an immutable snapshot, taken when the picker was built, of
+	// the connectivity state of every subConn on the ring. Pick reads from
+	// this snapshot instead of the live (mutex-guarded) subConn state: doing
+	// the latter let a subConn transition (e.g. Idle->Connecting) slip in
+	// between a Pick's read of the state and its decision to call Connect(),
+	// which could leave the ring with no subConn attempting to connect even
+	// while the aggregate state was TransientFailure. Building a new picker
+	// on every subConn transition (see regeneratePicker) keeps this snapshot
+	// fresh enough to drive picks correctly.
+	scStates map[*subConn]connectivity.State
+	// scErrs snapshots, alongside scStates, the error from each subConn's
+	// most recent TransientFailure report, so handleTransientFailure can
+	// build a composite error without reaching back into the (possibly
+	// already-changed-again) live subConns.
+	scErrs map[*subConn]error
+}
+
+func newPicker(r *ring, requestMetadataKey, hashFunction string) *picker {
+	var scStates map[*subConn]connectivity.State
+	var scErrs map[*subConn]error
+	if r != nil {
+		scStates = make(map[*subConn]connectivity.State, len(r.items))
+		scErrs = make(map[*subConn]error, len(r.items))
+		for _, it := range r.items {
+			if _, ok := scStates[it.sc]; !ok {
+				scStates[it.sc] = it.sc.effectiveState()
+				scErrs[it.sc] = it.sc.lastConnErr()
+			}
+		}
+	}
+	return &picker{ring: r, requestMetadataKey: requestMetadataKey, hashFunction: hashFunction, scStates: scStates, scErrs: scErrs}
+}
+
+// requestHash returns the hash to use for this pick. When a
+// RequestMetadataKey is configured, the hash is derived from the named
+// outgoing metadata header, so that ring_hash can be driven without an xDS
+// control plane (e.g. a plain DNS resolver plus service config). Otherwise,
+// it uses the hash set on the context by the CDS balancer, if any. Either
+// way, if there's no hash to be had, a random one is used so the ring still
+// picks some subConn instead of always landing on the same one.
+func (p *picker) requestHash(info balancer.PickInfo) uint64 {
+	if p.requestMetadataKey != "" {
+		if md, ok := metadata.FromOutgoingContext(info.Ctx); ok {
+			if vs := md.Get(p.requestMetadataKey); len(vs) > 0 {
+				return hashString(p.hashFunction, strings.Join(vs, ","))
+			}
+		}
+		return randUint64()
+	}
+	if h, ok := getRequestHash(info.Ctx); ok {
+		return h
+	}
+	return randUint64()
+}
+
+func randUint64() uint64 {
+	return grpcrand.Uint64()
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	e := p.ring.pick(p.requestHash(info))
+
+	var firstIdle *ringEntry
+	cur := e
+	for i := 0; i < len(p.ring.items); i++ {
+		switch p.scStates[cur.sc] {
+		case connectivity.Ready:
+			return balancer.PickResult{SubConn: cur.sc.sc}, nil
+		case connectivity.Idle:
+			if firstIdle == nil {
+				firstIdle = cur
+			}
+		case connectivity.TransientFailure:
+			// Remember to connect this subConn on its own once it exits
+			// backoff, in case no further RPC picks it again.
+			cur.sc.queueConnect()
+		}
+		cur = p.ring.next(cur)
+	}
+
+	if firstIdle != nil {
+		firstIdle.sc.connect()
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+
+	// No subConn is Ready or Idle; the ring is either still Connecting or
+	// wholly in TransientFailure.
+	for _, st := range p.scStates {
+		if st != connectivity.TransientFailure {
+			return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+		}
+	}
+	return balancer.PickResult{}, p.handleTransientFailure()
+}
+
+// maxErrorsInAggregate bounds how many distinct subConn errors
+// handleTransientFailure lists out, so a ring with many backends still
+// produces a readable error.
+const maxErrorsInAggregate = 3
+
+// handleTransientFailure builds an error summarizing why every subConn on
+// the ring is down, aggregating up to the first few distinct errors so that
+// a caller looking for a specific cause (e.g. via errors.Is) can still find
+// it, however many subConns are failing the same way.
+func (p *picker) handleTransientFailure() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, it := range p.ring.items {
+		if len(errs) >= maxErrorsInAggregate {
+			break
+		}
+		err := p.scErrs[it.sc]
+		if err == nil || seen[err.Error()] {
+			continue
+		}
+		seen[err.Error()] = true
+		addr := it.sc.addrs[0].Addr
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+	return &aggregateTFError{numSubConns: len(p.scStates), errs: errs}
+}
+
+// aggregateTFError is returned by a Pick when every subConn on the ring is
+// in TransientFailure. It reports the total number of failing subConns
+// alongside a sample of their underlying errors, and supports errors.Is
+// against any of those underlying errors.
+type aggregateTFError struct {
+	numSubConns int
+	errs        []error
+}
+
+func (e *aggregateTFError) Error() string {
+	strs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		strs[i] = err.Error()
+	}
+	return fmt.Sprintf("ringhash: all %d subconns in TransientFailure; last errors: [%s]", e.numSubConns, strings.Join(strs, "; "))
+}
+
+func (e *aggregateTFError) Unwrap() []error {
+	return e.errs
+}
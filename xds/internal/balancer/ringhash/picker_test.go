@@ -0,0 +1,88 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+)
+
+// TestPickerRequestHash_Header covers that, when a RequestMetadataKey is
+// configured, the picker hashes the named outgoing metadata header instead
+// of reading the xDS-set context hash.
+func (s) TestPickerRequestHash_Header(t *testing.T) {
+	const key = "x-user-id"
+	p := newPicker(nil, key, hashFunctionXXHash)
+
+	md := metadata.Pairs(key, "alice", key, "bob")
+	info := balancer.PickInfo{Ctx: metadata.NewOutgoingContext(ctxWithHash(12345), md)}
+
+	want := xxhash.Sum64String(strings.Join(md.Get(key), ","))
+	if got := p.requestHash(info); got != want {
+		t.Fatalf("requestHash() = %d, want %d (hash of joined header values)", got, want)
+	}
+}
+
+// TestPickerRequestHash_HeaderMissing covers that, when a RequestMetadataKey
+// is configured but the RPC has no matching header, the picker falls back to
+// a random hash rather than the xDS context hash.
+func (s) TestPickerRequestHash_HeaderMissing(t *testing.T) {
+	p := newPicker(nil, "x-user-id", hashFunctionXXHash)
+
+	info := balancer.PickInfo{Ctx: ctxWithHash(42)}
+	if got := p.requestHash(info); got == 42 {
+		t.Fatalf("requestHash() = %d, want a random hash, not the xDS context hash", got)
+	}
+}
+
+// TestPickerRequestHash_NoKeyConfigured covers that, without a
+// RequestMetadataKey, the picker keeps using the xDS-set context hash, even
+// if outgoing metadata happens to be present.
+func (s) TestPickerRequestHash_NoKeyConfigured(t *testing.T) {
+	p := newPicker(nil, "", hashFunctionXXHash)
+
+	md := metadata.Pairs("x-user-id", "alice")
+	info := balancer.PickInfo{Ctx: metadata.NewOutgoingContext(ctxWithHash(42), md)}
+	if got := p.requestHash(info); got != 42 {
+		t.Fatalf("requestHash() = %d, want 42 (the xDS context hash)", got)
+	}
+}
+
+// TestPickerRequestHash_NoKeyNoContextHash covers ring_hash used without an
+// xDS control plane at all: no RequestMetadataKey is configured, and nothing
+// ever called SetRequestHash on the context. The picker must fall back to a
+// random hash (and, crucially, not always the same one) rather than always
+// treating the pick as hash 0.
+func (s) TestPickerRequestHash_NoKeyNoContextHash(t *testing.T) {
+	p := newPicker(nil, "", hashFunctionXXHash)
+
+	info := balancer.PickInfo{Ctx: context.Background()}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 20; i++ {
+		seen[p.requestHash(info)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("requestHash() returned the same value %d times in a row, want randomized hashes", 20)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// TestPickTransientFailure_AggregateError covers that, when every subConn on
+// the ring is in TransientFailure, Pick returns a composite error mentioning
+// the total subConn count and a sample of the underlying connection errors,
+// and that errors.Is still finds a specific underlying error through it.
+func (s) TestPickTransientFailure_AggregateError(t *testing.T) {
+	wantErr := errors.New("dial tcp: connection refused")
+	subConns := make(map[string]*subConn)
+	for i, addr := range testBackendAddrStrs[:4] {
+		scw := &subConn{addrs: []resolver.Address{{Addr: addr}}, weight: 1}
+		scw.setState(connectivity.TransientFailure)
+		if i == 0 {
+			scw.setConnErr(fmt.Errorf("connecting to %s: %w", addr, wantErr))
+		} else {
+			scw.setConnErr(errors.New("some other failure"))
+		}
+		subConns[addr] = scw
+	}
+	r, err := newRing(subConns, 4, 10, hashFunctionXXHash)
+	if err != nil {
+		t.Fatalf("newRing() failed: %v", err)
+	}
+	p := newPicker(r, "", hashFunctionXXHash)
+
+	_, pickErr := p.Pick(balancer.PickInfo{Ctx: ctxWithHash(0)})
+	if pickErr == nil {
+		t.Fatalf("Pick() returned a nil error, want an aggregate TransientFailure error")
+	}
+	if !strings.Contains(pickErr.Error(), "all 4 subconns in TransientFailure") {
+		t.Fatalf("Pick() error = %q, want it to mention all 4 subconns", pickErr)
+	}
+	if !errors.Is(pickErr, wantErr) {
+		t.Fatalf("errors.Is(%v, wantErr) = false, want true", pickErr)
+	}
+}
+
+// TestPickTransientFailure_AggregateErrorTruncated covers that the aggregate
+// error only lists the first few distinct underlying errors, even when more
+// subConns are failing.
+func (s) TestPickTransientFailure_AggregateErrorTruncated(t *testing.T) {
+	subConns := make(map[string]*subConn)
+	for i, addr := range testBackendAddrStrs[:6] {
+		scw := &subConn{addrs: []resolver.Address{{Addr: addr}}, weight: 1}
+		scw.setState(connectivity.TransientFailure)
+		scw.setConnErr(fmt.Errorf("failure %d", i))
+		subConns[addr] = scw
+	}
+	r, err := newRing(subConns, 6, 10, hashFunctionXXHash)
+	if err != nil {
+		t.Fatalf("newRing() failed: %v", err)
+	}
+	p := newPicker(r, "", hashFunctionXXHash)
+
+	_, pickErr := p.Pick(balancer.PickInfo{Ctx: ctxWithHash(0)})
+	if got, want := strings.Count(pickErr.Error(), "failure "), maxErrorsInAggregate; got != want {
+		t.Fatalf("aggregate error lists %d underlying errors, want %d: %v", got, want, pickErr)
+	}
+}
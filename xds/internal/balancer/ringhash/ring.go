@@ -0,0 +1,226 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// subConn is ringhash's bookkeeping for a balancer.SubConn backing one
+// endpoint. addrs holds every address of that endpoint, in the order they
+// were passed to NewSubConn: the SubConn itself falls back through them on
+// a connection failure, so ringhash only needs to track the endpoint as a
+// whole, not each individual address.
+type subConn struct {
+	addrs  []resolver.Address
+	weight uint32
+	sc     balancer.SubConn
+
+	mu    sync.RWMutex
+	state connectivity.State
+	// connErr is the error from the most recent ConnectivityState report
+	// carrying TransientFailure, kept around so the picker can surface it
+	// in the aggregate error returned when every subConn is down.
+	connErr error
+	// connectQueued records that a Pick walked past this subConn while it
+	// was in TransientFailure; the next time it settles in Idle (i.e. its
+	// backoff timer fires), it should connect on its own even if no RPC
+	// picks it again.
+	connectQueued bool
+	// connecting records that the balancer has an outstanding Connect()
+	// call for this subConn whose result hasn't been reported yet, so the
+	// TF-recovery logic doesn't need to kick another subConn.
+	connecting bool
+}
+
+func (sc *subConn) setState(s connectivity.State) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.state = s
+}
+
+func (sc *subConn) effectiveState() connectivity.State {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.state
+}
+
+// setConnErr records the error from a TransientFailure report.
+func (sc *subConn) setConnErr(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.connErr = err
+}
+
+// lastConnErr returns the error recorded by the most recent setConnErr call.
+func (sc *subConn) lastConnErr() error {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.connErr
+}
+
+// queueConnect marks sc so that it connects on its own the next time it
+// settles in Idle.
+func (sc *subConn) queueConnect() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.connectQueued = true
+}
+
+// dequeueConnect reports and clears whether sc had a connect queued.
+func (sc *subConn) dequeueConnect() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	q := sc.connectQueued
+	sc.connectQueued = false
+	return q
+}
+
+// connect calls Connect on the underlying SubConn and records that an
+// attempt is outstanding.
+func (sc *subConn) connect() {
+	sc.mu.Lock()
+	sc.connecting = true
+	sc.mu.Unlock()
+	sc.sc.Connect()
+}
+
+// isConnecting reports whether sc has an outstanding Connect() attempt whose
+// result hasn't been reported via UpdateSubConnState yet.
+func (sc *subConn) isConnecting() bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.connecting
+}
+
+// clearConnecting marks that a previously outstanding Connect() attempt has
+// now been reported via UpdateSubConnState.
+func (sc *subConn) clearConnecting() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.connecting = false
+}
+
+// ringEntry is a single position on the consistent hash ring. It points back
+// to the subConn that should serve picks landing at hash.
+type ringEntry struct {
+	idx  int
+	hash uint64
+	sc   *subConn
+}
+
+// ring is ring_hash's consistent hash ring. Addresses are replicated onto it
+// proportionally to their weight, following the algorithm described by the
+// xDS ring_hash LB policy spec.
+type ring struct {
+	items []*ringEntry
+}
+
+// newRing creates a new ring from the given subConns, sized between
+// minRingSize and maxRingSize based on the subConns' weights. hashFn selects
+// which hash function is used to place entries on the ring; it must be one
+// of the hashFunction* constants in config.go.
+func newRing(subConns map[string]*subConn, minRingSize, maxRingSize uint64, hashFn string) (*ring, error) {
+	if len(subConns) == 0 {
+		return nil, fmt.Errorf("ringhash: no subConns to build ring from")
+	}
+
+	addrs := make([]string, 0, len(subConns))
+	var weightSum uint64
+	for addr, sc := range subConns {
+		addrs = append(addrs, addr)
+		weightSum += uint64(sc.weight)
+	}
+	// Sort for determinism: two rings built from the same set of weighted
+	// addresses must be identical.
+	sort.Strings(addrs)
+
+	// Normalize weights to fractions of the whole, then scale the ring to at
+	// least minRingSize entries, rounded up so that the subConn with the
+	// smallest share gets a whole number of them, capping the result at
+	// maxRingSize. This mirrors
+	// the ring sizing algorithm from the xDS ring_hash LB policy spec: the
+	// ring's size is driven by how finely the smallest weight needs to be
+	// resolved, not by the number of subConns.
+	minNormalizedWeight := 1.0
+	normalizedWeights := make(map[string]float64, len(addrs))
+	for _, addr := range addrs {
+		w := float64(subConns[addr].weight) / float64(weightSum)
+		normalizedWeights[addr] = w
+		if w < minNormalizedWeight {
+			minNormalizedWeight = w
+		}
+	}
+	scale := math.Min(math.Ceil(minNormalizedWeight*float64(minRingSize))/minNormalizedWeight, float64(maxRingSize))
+	ringSize := uint64(math.Ceil(scale))
+
+	// Walk the addresses in order, accumulating each one's exact (fractional)
+	// share of ringSize into targetHashes and emitting entries until
+	// currentHashes catches up. Rounding the per-address count independently
+	// (e.g. uint64(normalizedWeight*ringSize)) would truncate on every
+	// address and let the shortfall compound across the whole ring; carrying
+	// the remainder forward this way bounds the total deviation from
+	// ringSize to at most one entry.
+	items := make([]*ringEntry, 0, ringSize)
+	var currentHashes, targetHashes float64
+	for _, addr := range addrs {
+		sc := subConns[addr]
+		targetHashes += float64(ringSize) * normalizedWeights[addr]
+		for i := 0; currentHashes < targetHashes; i++ {
+			h := hashString(hashFn, fmt.Sprintf("%s_%d", addr, i))
+			items = append(items, &ringEntry{hash: h, sc: sc})
+			currentHashes++
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].hash < items[j].hash })
+	for i, it := range items {
+		it.idx = i
+	}
+	return &ring{items: items}, nil
+}
+
+// pick returns the ringEntry whose hash is the smallest hash greater than or
+// equal to h, wrapping around to the first entry if h is larger than every
+// hash on the ring.
+func (r *ring) pick(h uint64) *ringEntry {
+	i := sort.Search(len(r.items), func(i int) bool { return r.items[i].hash >= h })
+	if i == len(r.items) {
+		i = 0
+	}
+	return r.items[i]
+}
+
+// next returns the ringEntry immediately after e on the ring, wrapping
+// around. It's used to find the next candidate subConn when the one an RPC
+// hashed to isn't in a usable state.
+func (r *ring) next(e *ringEntry) *ringEntry {
+	next := e.idx + 1
+	if next == len(r.items) {
+		next = 0
+	}
+	return r.items[next]
+}
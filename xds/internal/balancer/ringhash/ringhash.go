@@ -0,0 +1,316 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package ringhash implements the ring_hash balancer.
+package ringhash
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+	"google.golang.org/grpc/connectivity"
+	internalgrpclog "google.golang.org/grpc/internal/grpclog"
+	"google.golang.org/grpc/resolver"
+	xdsinternal "google.golang.org/grpc/xds/internal"
+)
+
+// Name is the name of the ring_hash balancer.
+const Name = "ring_hash_experimental"
+
+func init() {
+	balancer.Register(bb{})
+}
+
+type bb struct{}
+
+func (bb) Name() string {
+	return Name
+}
+
+func (bb) Build(cc balancer.ClientConn, _ balancer.BuildOptions) balancer.Balancer {
+	b := &ringhashBalancer{
+		cc:       cc,
+		subConns: make(map[string]*subConn),
+		scStates: make(map[balancer.SubConn]*subConn),
+		csEvltr:  &connectivityStateEvaluator{},
+		state:    connectivity.Connecting,
+	}
+	b.logger = prefixLogger(b)
+	b.logger.Infof("Created")
+	return b
+}
+
+// ringhashBalancer implements the ring_hash LB policy, as specified in
+// gRFC A42.
+type ringhashBalancer struct {
+	cc     balancer.ClientConn
+	logger *internalgrpclog.PrefixLogger
+
+	config *LBConfig
+	ring   *ring
+
+	// subConns is keyed by endpointHashKey(endpoint), so that an update
+	// carrying the same endpoints (but a new slice/attribute pointer)
+	// doesn't recreate subConns.
+	subConns map[string]*subConn
+	scStates map[balancer.SubConn]*subConn
+	csEvltr  *connectivityStateEvaluator
+	state    connectivity.State
+
+	resolverErr error
+}
+
+func (b *ringhashBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	newConfig, ok := s.BalancerConfig.(*LBConfig)
+	if !ok {
+		return fmt.Errorf("ringhash: unsupported balancer config type: %T", s.BalancerConfig)
+	}
+	oldConfig := b.config
+	b.config = newConfig
+	b.resolverErr = nil
+
+	// ringChanged tracks whether this update actually adds or removes a
+	// subConn (or changes one's weight): if it doesn't, and the config
+	// hasn't changed either, the ring is unaffected and there's no need to
+	// rebuild it or push a new picker.
+	var ringChanged bool
+
+	endpoints := endpointsFromResolverState(s.ResolverState)
+	keysSeen := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		if len(ep.Addresses) == 0 {
+			continue
+		}
+		key := endpointHashKey(ep)
+		keysSeen[key] = true
+		weight := weightedroundrobin.GetAddrInfo(ep.Addresses[0]).Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if scw, ok := b.subConns[key]; ok {
+			if scw.weight != weight {
+				scw.weight = weight
+				ringChanged = true
+			}
+			continue
+		}
+		// ep.Addresses is passed through as-is: the SubConn itself will fall
+		// back through the endpoint's remaining addresses on a connection
+		// failure before reporting TransientFailure, so ringhash only has to
+		// place the endpoint once on the ring.
+		sc, err := b.cc.NewSubConn(ep.Addresses, balancer.NewSubConnOptions{})
+		if err != nil {
+			b.logger.Warningf("Failed to create new SubConn for endpoint %v: %v", ep.Addresses, err)
+			continue
+		}
+		scw := &subConn{addrs: ep.Addresses, weight: weight, sc: sc}
+		scw.setState(connectivity.Idle)
+		b.subConns[key] = scw
+		b.scStates[sc] = scw
+		ringChanged = true
+	}
+
+	for key, scw := range b.subConns {
+		if !keysSeen[key] {
+			scw.sc.Shutdown()
+			delete(b.subConns, key)
+			delete(b.scStates, scw.sc)
+			ringChanged = true
+		}
+	}
+
+	if !ringChanged && oldConfig != nil && *oldConfig == *newConfig {
+		return nil
+	}
+
+	r, err := newRing(b.subConns, b.config.MinRingSize, b.config.MaxRingSize, b.config.HashFunction)
+	if err != nil {
+		return fmt.Errorf("ringhash: failed to build ring: %v", err)
+	}
+	b.ring = r
+	b.regeneratePicker()
+	return nil
+}
+
+// endpointsFromResolverState returns the endpoints to place on the ring.
+// Resolvers that are endpoint-aware (e.g. xDS) populate
+// ResolverState.Endpoints directly; others (e.g. a plain DNS resolver used
+// without an xDS control plane) only populate ResolverState.Addresses, in
+// which case each address is treated as its own single-address endpoint.
+func endpointsFromResolverState(s resolver.State) []resolver.Endpoint {
+	if len(s.Endpoints) > 0 {
+		return s.Endpoints
+	}
+	endpoints := make([]resolver.Endpoint, 0, len(s.Addresses))
+	for _, addr := range s.Addresses {
+		endpoints = append(endpoints, resolver.Endpoint{
+			Addresses:  []resolver.Address{addr},
+			Attributes: addr.BalancerAttributes,
+		})
+	}
+	return endpoints
+}
+
+// endpointHashKey returns the string used both to place ep on the ring and
+// to recognize it across resolver updates. Per A76, an endpoint is placed on
+// the ring using its first address and locality, so that an endpoint with
+// multiple addresses (used for connection fallback, not for load spreading)
+// still contributes a single ring entry.
+func endpointHashKey(ep resolver.Endpoint) string {
+	return fmt.Sprintf("%s_%+v", ep.Addresses[0].Addr, xdsinternal.GetLocalityID(ep.Addresses[0]))
+}
+
+func (b *ringhashBalancer) ResolverError(err error) {
+	b.resolverErr = err
+	if len(b.subConns) == 0 {
+		b.state = connectivity.TransientFailure
+	}
+	if b.state != connectivity.TransientFailure {
+		return
+	}
+	b.regeneratePicker()
+}
+
+func (b *ringhashBalancer) UpdateSubConnState(sc balancer.SubConn, s balancer.SubConnState) {
+	scw, ok := b.scStates[sc]
+	if !ok {
+		return
+	}
+	oldState := scw.effectiveState()
+	if oldState == connectivity.TransientFailure && s.ConnectivityState == connectivity.Connecting {
+		// Ignore transitions from TransientFailure to Connecting, to avoid
+		// aggregate state flapping while subConns are in a backoff loop.
+		return
+	}
+	// This report supersedes any outstanding Connect() we triggered.
+	scw.clearConnecting()
+	scw.setState(s.ConnectivityState)
+
+	if s.ConnectivityState == connectivity.TransientFailure {
+		scw.setConnErr(s.ConnectionError)
+	}
+
+	b.state = b.csEvltr.recordTransition(oldState, s.ConnectivityState)
+
+	if oldState == connectivity.TransientFailure && s.ConnectivityState == connectivity.Idle {
+		if scw.dequeueConnect() {
+			// An earlier Pick walked past scw while it was down; now that
+			// it's out of backoff, let it try again on its own.
+			scw.connect()
+		} else {
+			// Otherwise, make sure some subConn is always attempting to
+			// connect, so the ring can recover even without RPCs driving it.
+			b.connectNextInRing(scw)
+		}
+	}
+
+	b.regeneratePicker()
+}
+
+// connectNextInRing walks the ring, starting right after from, and calls
+// Connect() on the first subConn it finds that isn't already Ready or in the
+// middle of a connection attempt. It's a no-op if some other subConn is
+// already attempting to connect, since only one is needed to make progress.
+func (b *ringhashBalancer) connectNextInRing(from *subConn) {
+	if b.ring == nil {
+		return
+	}
+	// If some other subConn is already Ready or mid-connect, the ring is
+	// already making progress; no need to kick another one.
+	for _, scw := range b.subConns {
+		if scw == from {
+			continue
+		}
+		if st := scw.effectiveState(); st == connectivity.Ready || st == connectivity.Connecting || scw.isConnecting() {
+			return
+		}
+	}
+
+	var start *ringEntry
+	for _, it := range b.ring.items {
+		if it.sc == from {
+			start = it
+			break
+		}
+	}
+	if start == nil {
+		return
+	}
+	for cur := b.ring.next(start); cur != start; cur = b.ring.next(cur) {
+		if cur.sc.effectiveState() == connectivity.Idle {
+			cur.sc.connect()
+			return
+		}
+	}
+}
+
+func (b *ringhashBalancer) regeneratePicker() {
+	if b.ring == nil {
+		return
+	}
+	b.cc.UpdateState(balancer.State{
+		ConnectivityState: b.state,
+		Picker:            newPicker(b.ring, b.config.RequestMetadataKey, b.config.HashFunction),
+	})
+}
+
+func (b *ringhashBalancer) Close() {}
+
+func (b *ringhashBalancer) ExitIdle() {
+	for _, scw := range b.subConns {
+		if scw.effectiveState() == connectivity.Idle {
+			scw.sc.Connect()
+		}
+	}
+}
+
+// connectivityStateEvaluator takes the connectivity states of a set of
+// subConns and returns one aggregated connectivity state. It's not safe for
+// concurrent use.
+type connectivityStateEvaluator struct {
+	numReady            uint64
+	numConnecting       uint64
+	numTransientFailure uint64
+}
+
+// recordTransition records a state change happening in one subConn and,
+// based on the states of all subConns, returns the aggregated state. It can
+// only be called synchronously, and oldState/newState must differ.
+func (cse *connectivityStateEvaluator) recordTransition(oldState, newState connectivity.State) connectivity.State {
+	for idx, state := range []connectivity.State{oldState, newState} {
+		updateVal := 2*uint64(idx) - 1 // -1 for oldState, +1 for newState.
+		switch state {
+		case connectivity.Ready:
+			cse.numReady += updateVal
+		case connectivity.Connecting:
+			cse.numConnecting += updateVal
+		case connectivity.TransientFailure:
+			cse.numTransientFailure += updateVal
+		}
+	}
+
+	switch {
+	case cse.numReady > 0:
+		return connectivity.Ready
+	case cse.numConnecting >= cse.numTransientFailure:
+		return connectivity.Connecting
+	default:
+		return connectivity.TransientFailure
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/testutils"
+	"google.golang.org/grpc/resolver"
+)
+
+func twoAddrEndpoint(addr1, addr2 string) resolver.Endpoint {
+	return resolver.Endpoint{Addresses: []resolver.Address{{Addr: addr1}, {Addr: addr2}}}
+}
+
+// TestNewRing_EndpointWithMultipleAddresses covers that an endpoint with
+// several addresses (used for connection fallback, not for spreading load)
+// only contributes a single ring entry, not one per address.
+func (s) TestNewRing_EndpointWithMultipleAddresses(t *testing.T) {
+	endpoints := []resolver.Endpoint{
+		twoAddrEndpoint(testBackendAddrStrs[0], testBackendAddrStrs[1]),
+		twoAddrEndpoint(testBackendAddrStrs[2], testBackendAddrStrs[3]),
+	}
+	subConns := make(map[string]*subConn)
+	for _, ep := range endpoints {
+		subConns[endpointHashKey(ep)] = &subConn{addrs: ep.Addresses, weight: 1}
+	}
+	if len(subConns) != 2 {
+		t.Fatalf("got %d distinct subConns for 2 endpoints, want 2", len(subConns))
+	}
+
+	r, err := newRing(subConns, 2, 10, hashFunctionXXHash)
+	if err != nil {
+		t.Fatalf("newRing() failed: %v", err)
+	}
+	if got := len(r.items); got != 2 {
+		t.Fatalf("ring built from 2 endpoints (2 addresses each) has %d entries, want 2", got)
+	}
+}
+
+// TestNewRing_EntryCountMatchesRingSize covers that newRing distributes
+// entries so that the total actually reaches ringSize, even across many
+// addresses with skewed weights: rounding each address's share down
+// independently would let the shortfall compound over hundreds of
+// addresses, instead of bounding it to at most one entry overall.
+func (s) TestNewRing_EntryCountMatchesRingSize(t *testing.T) {
+	const minRingSize, maxRingSize = 1024, 4096
+
+	subConns := make(map[string]*subConn)
+	var weightSum uint64
+	minNormalizedWeight := 1.0
+	for i := 0; i < 200; i++ {
+		addr := fmt.Sprintf("addr-%d", i)
+		weight := uint32(i%5 + 1)
+		subConns[addr] = &subConn{weight: weight}
+		weightSum += uint64(weight)
+	}
+	for _, sc := range subConns {
+		if w := float64(sc.weight) / float64(weightSum); w < minNormalizedWeight {
+			minNormalizedWeight = w
+		}
+	}
+	scale := math.Min(math.Ceil(minNormalizedWeight*minRingSize)/minNormalizedWeight, maxRingSize)
+	wantRingSize := uint64(math.Ceil(scale))
+
+	r, err := newRing(subConns, minRingSize, maxRingSize, hashFunctionXXHash)
+	if err != nil {
+		t.Fatalf("newRing() failed: %v", err)
+	}
+	if got := uint64(len(r.items)); got != wantRingSize {
+		t.Fatalf("ring built from 200 addresses with weights 1-5 has %d entries, want %d (rounding each address's share down independently must not let the shortfall compound)", got, wantRingSize)
+	}
+}
+
+// TestEndpointAddressFallover covers that when the first address of a
+// multi-address endpoint goes down, the endpoint's subConn (and therefore
+// its position on the ring) stays the same: the SubConn itself falls back to
+// the endpoint's other addresses.
+func (s) TestEndpointAddressFallover(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	builder := balancer.Get(Name)
+	b := builder.Build(cc, balancer.BuildOptions{})
+
+	ep := twoAddrEndpoint(testBackendAddrStrs[0], testBackendAddrStrs[1])
+	if err := b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Endpoints: []resolver.Endpoint{ep}},
+		BalancerConfig: testConfig,
+	}); err != nil {
+		t.Fatalf("UpdateClientConnState returned err: %v", err)
+	}
+
+	gotAddrs := <-cc.NewSubConnAddrsCh
+	if len(gotAddrs) != 2 || gotAddrs[0].Addr != testBackendAddrStrs[0] || gotAddrs[1].Addr != testBackendAddrStrs[1] {
+		t.Fatalf("NewSubConn called with addrs %v, want both endpoint addresses in order", gotAddrs)
+	}
+	sc := <-cc.NewSubConnCh
+
+	p0 := <-cc.NewPickerCh
+	ring0 := p0.(*picker).ring
+	if len(ring0.items) != 1 {
+		t.Fatalf("ring has %d entries for 1 endpoint, want 1", len(ring0.items))
+	}
+
+	// The address-level fallback (trying addrs[1] after addrs[0] fails) is
+	// internal to the SubConn; from ringhash's point of view, the first sign
+	// of life is the SubConn eventually reporting Ready.
+	b.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.Connecting})
+	b.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.Ready})
+
+	var p1 balancer.Picker
+	select {
+	case p1 = <-cc.NewPickerCh:
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("timeout waiting for picker after SubConn went Ready")
+	}
+	if p1.(*picker).ring != ring0 {
+		t.Fatalf("ring changed after a connectivity transition on the same endpoint, want it unchanged")
+	}
+
+	got, err := p1.Pick(balancer.PickInfo{Ctx: ctxWithHash(0)})
+	if err != nil || got.SubConn != sc {
+		t.Fatalf("Pick() = %v, %v; want the endpoint's single SubConn, nil", got, err)
+	}
+}
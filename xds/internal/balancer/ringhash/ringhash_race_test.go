@@ -0,0 +1,103 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ringhash
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/testutils"
+	"google.golang.org/grpc/resolver"
+)
+
+// TestPickWhileSubConnsCycling is a regression test for a race where a Pick
+// could read a subConn's connectivity state right before it changed, and
+// then trigger Connect() based on stale information, leaving the ring with
+// no subConn attempting to connect even though the aggregated state was
+// TransientFailure. It drives three subConns through repeated
+// TransientFailure->Idle cycles concurrently with picks, and asserts that at
+// least one subConn was asked to Connect() during the run; it does not check
+// which subConns were connecting at any given moment.
+func (s) TestPickWhileSubConnsCycling(t *testing.T) {
+	wantAddrs := []resolver.Address{
+		{Addr: testBackendAddrStrs[0]},
+		{Addr: testBackendAddrStrs[1]},
+		{Addr: testBackendAddrStrs[2]},
+	}
+	cc, b, p0 := setupTest(t, wantAddrs)
+	ring0 := p0.(*picker).ring
+	scs := []balancer.SubConn{ring0.items[0].sc.sc, ring0.items[1].sc.sc, ring0.items[2].sc.sc}
+
+	connected := make(chan struct{}, len(scs)*64)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, sc := range scs {
+		sc := sc
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch := sc.(*testutils.TestSubConn).ConnectCh
+			for {
+				select {
+				case <-ch:
+					select {
+					case connected <- struct{}{}:
+					default:
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var driveWG sync.WaitGroup
+	driveWG.Add(2)
+	go func() {
+		defer driveWG.Done()
+		for i := 0; i < 200; i++ {
+			for _, sc := range scs {
+				b.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+				b.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.Idle})
+			}
+		}
+	}()
+	go func() {
+		defer driveWG.Done()
+		for i := 0; i < 2000; i++ {
+			select {
+			case p := <-cc.NewPickerCh:
+				p.Pick(balancer.PickInfo{Ctx: ctxWithHash(uint64(i))})
+			default:
+			}
+		}
+	}()
+	driveWG.Wait()
+	close(done)
+	wg.Wait()
+
+	select {
+	case <-connected:
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("no subConn ever attempted to connect while cycling through TransientFailure->Idle concurrently with picks")
+	}
+}
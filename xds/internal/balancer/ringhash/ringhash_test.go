@@ -418,13 +418,35 @@ func (s) TestSubConnToConnectWhenOverallTransientFailure(t *testing.T) {
 		{Addr: testBackendAddrStrs[1]},
 		{Addr: testBackendAddrStrs[2]},
 	}
-	_, b, p0 := setupTest(t, wantAddrs)
+	cc, b, p0 := setupTest(t, wantAddrs)
 	ring0 := p0.(*picker).ring
 
+	// nextPicker waits for the picker that regeneratePicker sends after every
+	// subConn transition, and checks that its state snapshot for sc already
+	// reflects want: the picker must be rebuilt fresh on every transition,
+	// not lazily read the (possibly already-changed-again) live subConn
+	// state the next time Pick is called.
+	nextPicker := func(sc balancer.SubConn, want connectivity.State) {
+		t.Helper()
+		select {
+		case p := <-cc.NewPickerCh:
+			pk := p.(*picker)
+			for scw, st := range pk.scStates {
+				if scw.sc == sc && st != want {
+					t.Fatalf("picker snapshot for %v = %v, want %v", sc, st, want)
+				}
+			}
+		case <-time.After(defaultTestTimeout):
+			t.Fatalf("timeout waiting for a new picker reflecting state %v for %v", want, sc)
+		}
+	}
+
 	// Turn the first subconn to transient failure.
 	sc0 := ring0.items[0].sc.sc
 	b.UpdateSubConnState(sc0, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+	nextPicker(sc0, connectivity.TransientFailure)
 	b.UpdateSubConnState(sc0, balancer.SubConnState{ConnectivityState: connectivity.Idle})
+	nextPicker(sc0, connectivity.Idle)
 
 	// It will trigger the second subconn to connect (because overall state is
 	// Connect (when one subconn is TF)).
@@ -437,7 +459,9 @@ func (s) TestSubConnToConnectWhenOverallTransientFailure(t *testing.T) {
 
 	// Turn the second subconn to TF. This will set the overall state to TF.
 	b.UpdateSubConnState(sc1, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+	nextPicker(sc1, connectivity.TransientFailure)
 	b.UpdateSubConnState(sc1, balancer.SubConnState{ConnectivityState: connectivity.Idle})
+	nextPicker(sc1, connectivity.Idle)
 
 	// It will trigger the third subconn to connect.
 	sc2 := ring0.items[2].sc.sc
@@ -449,7 +473,9 @@ func (s) TestSubConnToConnectWhenOverallTransientFailure(t *testing.T) {
 
 	// Turn the third subconn to TF. This will set the overall state to TF.
 	b.UpdateSubConnState(sc2, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+	nextPicker(sc2, connectivity.TransientFailure)
 	b.UpdateSubConnState(sc2, balancer.SubConnState{ConnectivityState: connectivity.Idle})
+	nextPicker(sc2, connectivity.Idle)
 
 	// It will trigger the first subconn to connect.
 	select {
@@ -460,7 +486,9 @@ func (s) TestSubConnToConnectWhenOverallTransientFailure(t *testing.T) {
 
 	// Turn the third subconn to TF again.
 	b.UpdateSubConnState(sc2, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+	nextPicker(sc2, connectivity.TransientFailure)
 	b.UpdateSubConnState(sc2, balancer.SubConnState{ConnectivityState: connectivity.Idle})
+	nextPicker(sc2, connectivity.Idle)
 
 	// This will not trigger any new Connect() on the SubConns, because sc0 is
 	// still attempting to connect, and we only need one SubConn to connect.